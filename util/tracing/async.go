@@ -0,0 +1,141 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+//
+// Author: Andrei Matei (andrei@cockroachlabs.com)
+
+package tracing
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"golang.org/x/net/context"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+)
+
+// asyncTask describes one goroutine currently running via RunAsync or
+// RunAsyncGroup, so that debug/requests can list in-flight forked spans per
+// node.
+type asyncTask struct {
+	opName string
+	span   opentracing.Span
+}
+
+var (
+	asyncRegistryMu sync.Mutex
+	asyncRegistry   = map[int64]asyncTask{}
+	asyncTaskIDGen  int64
+)
+
+// RegisteredAsyncTasks returns the operation names of all goroutines
+// currently in flight via RunAsync/RunAsyncGroup, in no particular order.
+// It backs the debug/requests endpoint's view of forked spans.
+func RegisteredAsyncTasks() []string {
+	asyncRegistryMu.Lock()
+	defer asyncRegistryMu.Unlock()
+	names := make([]string, 0, len(asyncRegistry))
+	for _, t := range asyncRegistry {
+		names = append(names, t.opName)
+	}
+	return names
+}
+
+func registerAsyncTask(opName string, span opentracing.Span) int64 {
+	id := atomic.AddInt64(&asyncTaskIDGen, 1)
+	asyncRegistryMu.Lock()
+	asyncRegistry[id] = asyncTask{opName: opName, span: span}
+	asyncRegistryMu.Unlock()
+	return id
+}
+
+func unregisterAsyncTask(id int64) {
+	asyncRegistryMu.Lock()
+	delete(asyncRegistry, id)
+	asyncRegistryMu.Unlock()
+}
+
+// RunAsync forks ctx's span via ForkCtxSpan -- which already knows to
+// detach rather than fork when the parent is a snowball span whose
+// recorder may no longer be live by the time fn returns -- launches fn in a
+// new goroutine against the forked context, and finishes the forked span
+// once fn returns. A panic inside fn is recovered, logged on the span with
+// an error tag, and reported (wrapped as an error) on the returned channel
+// instead of crashing the process. This spares callers from having to
+// remember to `go` the work, defer the finishing closure, and recover
+// panics themselves at every call site.
+//
+// The task's registry entry is removed and its span finished before the
+// result is sent on the returned channel, so a caller that checks
+// RegisteredAsyncTasks right after receiving never observes a task that's
+// actually already done.
+func RunAsync(ctx context.Context, opName string, fn func(context.Context) error) <-chan error {
+	forkedCtx, finish := ForkCtxSpan(ctx, opName)
+
+	var id int64
+	if sp := opentracing.SpanFromContext(forkedCtx); sp != nil {
+		id = registerAsyncTask(opName, sp)
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		err := runRecovering(forkedCtx, fn)
+		if id != 0 {
+			unregisterAsyncTask(id)
+		}
+		finish()
+		errCh <- err
+	}()
+	return errCh
+}
+
+// runRecovering calls fn, converting a panic into an error logged on ctx's
+// span (if any) rather than letting it escape the goroutine.
+func runRecovering(ctx context.Context, fn func(context.Context) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic in async task: %v", r)
+			if sp := opentracing.SpanFromContext(ctx); sp != nil {
+				ext.Error.Set(sp, true)
+				sp.LogKV("event", "panic", "error", true, "message", err.Error())
+			}
+		}
+	}()
+	return fn(ctx)
+}
+
+// RunAsyncGroup runs each of fns concurrently, each via RunAsync (so each
+// gets its own forked span and registry entry), and returns a channel on
+// which every non-nil error is reported; the channel is closed once all of
+// fns have returned.
+func RunAsyncGroup(ctx context.Context, opName string, fns ...func(context.Context) error) <-chan error {
+	errCh := make(chan error, len(fns))
+	var wg sync.WaitGroup
+	wg.Add(len(fns))
+	for i, fn := range fns {
+		go func(i int, fn func(context.Context) error) {
+			defer wg.Done()
+			if err := <-RunAsync(ctx, fmt.Sprintf("%s/%d", opName, i), fn); err != nil {
+				errCh <- err
+			}
+		}(i, fn)
+	}
+	go func() {
+		wg.Wait()
+		close(errCh)
+	}()
+	return errCh
+}
@@ -0,0 +1,110 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+//
+// Author: Andrei Matei (andrei@cockroachlabs.com)
+
+package tracing
+
+import (
+	"errors"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	opentracing "github.com/opentracing/opentracing-go"
+)
+
+func ctxWithSpan() context.Context {
+	tr := NewTracer()
+	sp := tr.StartSpan("parent")
+	return opentracing.ContextWithSpan(context.Background(), sp)
+}
+
+// TestRunAsyncRecoversPanic verifies that a panic inside the function passed
+// to RunAsync is recovered and reported as an error on the returned channel,
+// rather than crashing the test process.
+func TestRunAsyncRecoversPanic(t *testing.T) {
+	err := <-RunAsync(ctxWithSpan(), "panicky", func(context.Context) error {
+		panic("boom")
+	})
+	if err == nil {
+		t.Fatalf("expected an error from the recovered panic, got nil")
+	}
+}
+
+// TestRunAsyncReportsError verifies that a plain (non-panic) error returned
+// by fn is reported on the channel unchanged.
+func TestRunAsyncReportsError(t *testing.T) {
+	wantErr := errors.New("boom")
+	err := <-RunAsync(ctxWithSpan(), "erroring", func(context.Context) error {
+		return wantErr
+	})
+	if err != wantErr {
+		t.Fatalf("got error %v, expected %v", err, wantErr)
+	}
+}
+
+// TestRunAsyncRegistersAndUnregistersTask verifies that a RunAsync task is
+// visible via RegisteredAsyncTasks while in flight and gone once it
+// completes, since debug/requests relies on that to reflect reality.
+func TestRunAsyncRegistersAndUnregistersTask(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	errCh := RunAsync(ctxWithSpan(), "long-running", func(context.Context) error {
+		close(started)
+		<-release
+		return nil
+	})
+
+	<-started
+	if !containsTaskName(RegisteredAsyncTasks(), "long-running") {
+		t.Fatalf("expected RegisteredAsyncTasks to contain the in-flight task")
+	}
+	close(release)
+	<-errCh
+
+	if containsTaskName(RegisteredAsyncTasks(), "long-running") {
+		t.Fatalf("expected RegisteredAsyncTasks to no longer contain the finished task")
+	}
+}
+
+func containsTaskName(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// TestRunAsyncGroupReportsAllErrors verifies that RunAsyncGroup collects an
+// error from every failing function and closes the channel once all
+// functions have returned.
+func TestRunAsyncGroupReportsAllErrors(t *testing.T) {
+	errA := errors.New("a failed")
+	errB := errors.New("b failed")
+	errCh := RunAsyncGroup(ctxWithSpan(), "group",
+		func(context.Context) error { return errA },
+		func(context.Context) error { return nil },
+		func(context.Context) error { return errB },
+	)
+
+	var got []error
+	for err := range errCh {
+		got = append(got, err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %d errors, expected 2: %v", len(got), got)
+	}
+}
@@ -0,0 +1,151 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+//
+// Author: Andrei Matei (andrei@cockroachlabs.com)
+
+package tracing
+
+import (
+	"io"
+	"sync"
+
+	"golang.org/x/net/context"
+
+	"github.com/cockroachdb/cockroach/util/envutil"
+	"github.com/cockroachdb/cockroach/util/log"
+	opentracing "github.com/opentracing/opentracing-go"
+	zipkintracer "github.com/openzipkin/zipkin-go-opentracing"
+	jaeger "github.com/uber/jaeger-client-go"
+	jaegercfg "github.com/uber/jaeger-client-go/config"
+)
+
+// jaegerAgentAddr, when set, causes newTracer to report spans to a local
+// Jaeger agent (host:port) over Thrift/UDP, in addition to whatever other
+// collectors are configured.
+var jaegerAgentAddr = envutil.EnvOrDefaultString("COCKROACH_JAEGER_AGENT", "")
+
+// zipkinCollectorURL, when set, causes newTracer to report spans to a Zipkin
+// collector's HTTP endpoint, e.g. http://127.0.0.1:9411/api/v1/spans.
+var zipkinCollectorURL = envutil.EnvOrDefaultString("COCKROACH_ZIPKIN_URL", "")
+
+// newJaegerTracer returns a Tracer that reports every finished span to a
+// Jaeger agent listening on agentAddr via Thrift-over-UDP. Sampling
+// decisions are delegated to sampler, which (unlike a plain Jaeger
+// probabilistic sampler) is operation-name aware.
+func newJaegerTracer(agentAddr string, sampler *Sampler) (opentracing.Tracer, error) {
+	transport, err := jaeger.NewUDPTransport(agentAddr, 0 /* maxPacketSize */)
+	if err != nil {
+		return nil, err
+	}
+	reporter := jaeger.NewRemoteReporter(transport)
+	tr, closer, err := jaegercfg.Configuration{
+		ServiceName: "cockroach",
+	}.NewTracer(jaegercfg.Reporter(reporter), jaegercfg.Sampler(jaegerSamplerAdapter{sampler}))
+	if err != nil {
+		return nil, err
+	}
+	setJaegerCloser(closer)
+	return tr, nil
+}
+
+// jaegerCloserMu guards jaegerCloser.
+var jaegerCloserMu sync.Mutex
+
+// jaegerCloser releases the Jaeger tracer's reporter (flushing any
+// buffered spans and stopping its background goroutine). It is stashed
+// here, rather than discarded, by newJaegerTracer so that CloseJaegerTracer
+// has something to call at server shutdown.
+var jaegerCloser io.Closer
+
+func setJaegerCloser(closer io.Closer) {
+	jaegerCloserMu.Lock()
+	defer jaegerCloserMu.Unlock()
+	jaegerCloser = closer
+}
+
+// CloseJaegerTracer releases the resources held by the most recently
+// constructed Jaeger tracer, if any. It is a no-op if COCKROACH_JAEGER_AGENT
+// was never set. Callers that tear down a server should call this during
+// shutdown so the reporter's background goroutine doesn't leak.
+func CloseJaegerTracer() error {
+	jaegerCloserMu.Lock()
+	defer jaegerCloserMu.Unlock()
+	if jaegerCloser == nil {
+		return nil
+	}
+	return jaegerCloser.Close()
+}
+
+// newZipkinTracer returns a Tracer that reports every finished span to a
+// Zipkin collector's HTTP endpoint. zipkin-go-opentracing's sampler hook is
+// keyed by trace ID alone, so per-operation overrides don't apply here (see
+// Sampler.Allow).
+func newZipkinTracer(collectorURL string, sampler *Sampler) (opentracing.Tracer, error) {
+	collector, err := zipkintracer.NewHTTPCollector(collectorURL)
+	if err != nil {
+		return nil, err
+	}
+	recorder := zipkintracer.NewRecorder(collector, false /* debug */, "0.0.0.0:0", "cockroach")
+	return zipkintracer.NewTracer(
+		recorder,
+		zipkintracer.WithSampler(sampler.Allow),
+		zipkintracer.TraceID128Bit(true),
+	)
+}
+
+// jaegerSamplerAdapter adapts our Sampler to jaeger-client-go's
+// jaeger.Sampler interface, which -- unlike basictracer's and
+// zipkin-go-opentracing's -- is given the operation name, letting
+// per-operation overrides take full effect.
+type jaegerSamplerAdapter struct {
+	sampler *Sampler
+}
+
+// IsSampled implements jaeger.Sampler.
+func (a jaegerSamplerAdapter) IsSampled(traceID uint64, operation string) (bool, []jaeger.Tag) {
+	return a.sampler.ShouldSample(operation, traceID, nil), nil
+}
+
+// Close implements jaeger.Sampler.
+func (a jaegerSamplerAdapter) Close() {}
+
+// Equal implements jaeger.Sampler.
+func (a jaegerSamplerAdapter) Equal(other jaeger.Sampler) bool {
+	o, ok := other.(jaegerSamplerAdapter)
+	return ok && o.sampler == a.sampler
+}
+
+// extraTracers builds the Jaeger and/or Zipkin collectors requested via
+// COCKROACH_JAEGER_AGENT/COCKROACH_ZIPKIN_URL; see newTracer.
+func extraTracers() []opentracing.Tracer {
+	sampler := currentSampler()
+	var extra []opentracing.Tracer
+	if jaegerAgentAddr != "" {
+		tr, err := newJaegerTracer(jaegerAgentAddr, sampler)
+		if err != nil {
+			log.Errorf(context.Background(), "tracing: failed to initialize Jaeger collector: %s", err)
+		} else {
+			extra = append(extra, tr)
+		}
+	}
+	if zipkinCollectorURL != "" {
+		tr, err := newZipkinTracer(zipkinCollectorURL, sampler)
+		if err != nil {
+			log.Errorf(context.Background(), "tracing: failed to initialize Zipkin collector: %s", err)
+		} else {
+			extra = append(extra, tr)
+		}
+	}
+	return extra
+}
@@ -0,0 +1,88 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+//
+// Author: Andrei Matei (andrei@cockroachlabs.com)
+
+package tracing
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	basictracer "github.com/opentracing/basictracer-go"
+	otlog "github.com/opentracing/opentracing-go/log"
+)
+
+// TestEncodeDecodeRawSpanWithLogs exercises the case that motivated the
+// switch away from gob in the first place: a span with logs (and, within
+// those logs, structured fields), which is the overwhelming common case for
+// anything sampled or snowball-recorded.
+func TestEncodeDecodeRawSpanWithLogs(t *testing.T) {
+	start := time.Unix(1000, 0).UTC()
+	logTime := time.Unix(1000, 500).UTC()
+	orig := basictracer.RawSpan{
+		Context: basictracer.SpanContext{
+			TraceID: 1,
+			SpanID:  2,
+			Sampled: true,
+			Baggage: map[string]string{"sb": "1"},
+		},
+		ParentSpanID: 3,
+		Operation:    "test-op",
+		Start:        start,
+		Duration:     42 * time.Millisecond,
+		Tags:         map[string]interface{}{"k": "v"},
+		Logs: []basictracer.LogData{
+			{
+				Timestamp: logTime,
+				Fields: []otlog.Field{
+					otlog.String("event", "did a thing"),
+					otlog.Int64("count", 7),
+					otlog.Bool("error", false),
+				},
+			},
+			{
+				Timestamp: logTime,
+				Event:     "legacy event",
+			},
+		},
+	}
+
+	enc, err := EncodeRawSpan(&orig, nil)
+	if err != nil {
+		t.Fatalf("EncodeRawSpan: %s", err)
+	}
+
+	var got basictracer.RawSpan
+	if err := DecodeRawSpan(enc, &got); err != nil {
+		t.Fatalf("DecodeRawSpan: %s", err)
+	}
+
+	if len(got.Logs) != len(orig.Logs) {
+		t.Fatalf("got %d logs, expected %d", len(got.Logs), len(orig.Logs))
+	}
+	if len(got.Logs[0].Fields) != len(orig.Logs[0].Fields) {
+		t.Fatalf("got %d fields on first log, expected %d", len(got.Logs[0].Fields), len(orig.Logs[0].Fields))
+	}
+	if got.Logs[1].Event != "legacy event" {
+		t.Fatalf("got event %q, expected %q", got.Logs[1].Event, "legacy event")
+	}
+	if got.Context.TraceID != orig.Context.TraceID || got.Context.SpanID != orig.Context.SpanID {
+		t.Fatalf("span context mismatch: got %+v, expected %+v", got.Context, orig.Context)
+	}
+	if !reflect.DeepEqual(got.Context.Baggage, orig.Context.Baggage) {
+		t.Fatalf("baggage mismatch: got %+v, expected %+v", got.Context.Baggage, orig.Context.Baggage)
+	}
+}
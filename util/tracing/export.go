@@ -0,0 +1,147 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+//
+// Author: Andrei Matei (andrei@cockroachlabs.com)
+
+package tracing
+
+import (
+	"encoding/json"
+
+	basictracer "github.com/opentracing/basictracer-go"
+)
+
+// zipkinV2Span mirrors the subset of the Zipkin v2 JSON span schema
+// (https://zipkin.io/zipkin-api/#/default/post_spans) that a basictracer
+// RawSpan can populate.
+type zipkinV2Span struct {
+	TraceID       string            `json:"traceId"`
+	ID            string            `json:"id"`
+	ParentID      string            `json:"parentId,omitempty"`
+	Name          string            `json:"name"`
+	Timestamp     int64             `json:"timestamp"` // microseconds since epoch
+	Duration      int64             `json:"duration"`  // microseconds
+	Tags          map[string]string `json:"tags,omitempty"`
+	Annotations   []zipkinV2Annot   `json:"annotations,omitempty"`
+	LocalEndpoint zipkinV2Endpoint  `json:"localEndpoint"`
+}
+
+type zipkinV2Annot struct {
+	Timestamp int64  `json:"timestamp"`
+	Value     string `json:"value"`
+}
+
+type zipkinV2Endpoint struct {
+	ServiceName string `json:"serviceName"`
+}
+
+// DecodedSpansToZipkinJSON decodes a batch of spans previously produced by
+// EncodeRawSpan and renders them as a Zipkin v2 JSON span list, suitable for
+// POSTing to a Zipkin collector's /api/v2/spans endpoint or for loading into
+// any other tool that understands the format.
+func DecodedSpansToZipkinJSON(encodedSpans [][]byte) ([]byte, error) {
+	zspans := make([]zipkinV2Span, 0, len(encodedSpans))
+	for _, enc := range encodedSpans {
+		var sp basictracer.RawSpan
+		if err := DecodeRawSpan(enc, &sp); err != nil {
+			return nil, err
+		}
+		zspans = append(zspans, rawSpanToZipkinV2(&sp))
+	}
+	return json.Marshal(zspans)
+}
+
+func rawSpanToZipkinV2(sp *basictracer.RawSpan) zipkinV2Span {
+	z := zipkinV2Span{
+		TraceID:       formatZipkinID(sp.Context.TraceID),
+		ID:            formatZipkinID(sp.Context.SpanID),
+		Name:          sp.Operation,
+		Timestamp:     sp.Start.UnixNano() / 1e3,
+		Duration:      sp.Duration.Nanoseconds() / 1e3,
+		LocalEndpoint: zipkinV2Endpoint{ServiceName: "cockroach"},
+	}
+	if sp.ParentSpanID != 0 {
+		z.ParentID = formatZipkinID(sp.ParentSpanID)
+	}
+	if len(sp.Tags) > 0 {
+		z.Tags = make(map[string]string, len(sp.Tags))
+		for k, v := range sp.Tags {
+			z.Tags[k] = toString(v)
+		}
+	}
+	for _, l := range sp.Logs {
+		z.Annotations = append(z.Annotations, zipkinV2Annot{
+			Timestamp: l.Timestamp.UnixNano() / 1e3,
+			Value:     logAnnotationValue(l),
+		})
+	}
+	return z
+}
+
+// logAnnotationValue renders a log record as Zipkin's single annotation
+// string, preferring the event name (if any) and otherwise flattening any
+// structured fields logged via LogKV/LogFields.
+func logAnnotationValue(l basictracer.LogData) string {
+	if l.Event != "" {
+		return l.Event
+	}
+	parts := make(map[string]string, len(l.Fields))
+	for _, f := range l.Fields {
+		p := fieldToProto(f)
+		parts[p.Key] = fieldProtoValueString(p)
+	}
+	return toString(parts)
+}
+
+func fieldProtoValueString(p *FieldProto) string {
+	switch p.Type {
+	case FieldType_FIELD_TYPE_INT64:
+		return toString(p.Int64Value)
+	case FieldType_FIELD_TYPE_FLOAT64:
+		return toString(p.Float64Value)
+	case FieldType_FIELD_TYPE_BOOL:
+		return toString(p.BoolValue)
+	default:
+		return p.StringValue
+	}
+}
+
+func formatZipkinID(id uint64) string {
+	const hextable = "0123456789abcdef"
+	buf := make([]byte, 16)
+	for i := 15; i >= 0; i-- {
+		buf[i] = hextable[id&0xf]
+		id >>= 4
+	}
+	return string(buf)
+}
+
+func toString(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return jsonStringer{v}.String()
+}
+
+// jsonStringer falls back to JSON encoding for tag values that aren't
+// already strings (e.g. numbers or bools recorded via SetTag).
+type jsonStringer struct{ v interface{} }
+
+func (j jsonStringer) String() string {
+	b, err := json.Marshal(j.v)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
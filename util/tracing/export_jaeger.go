@@ -0,0 +1,121 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+//
+// Author: Andrei Matei (andrei@cockroachlabs.com)
+
+package tracing
+
+import (
+	basictracer "github.com/opentracing/basictracer-go"
+	jaegerthrift "github.com/uber/jaeger-client-go/thrift-gen/jaeger"
+)
+
+// DecodedSpansToJaegerBatch decodes a batch of spans previously produced by
+// EncodeRawSpan and renders them as a Jaeger Thrift Batch (the same model
+// jaeger-client-go's own reporters submit), suitable for handing to a
+// jaeger-client-go transport directly or for loading into any other tool
+// that understands Jaeger's native format. This is the Thrift counterpart
+// of DecodedSpansToZipkinJSON, so recorded snowball traces aren't locked
+// into Zipkin's (or Lightstep's) viewer either.
+func DecodedSpansToJaegerBatch(encodedSpans [][]byte) (*jaegerthrift.Batch, error) {
+	spans := make([]*jaegerthrift.Span, 0, len(encodedSpans))
+	for _, enc := range encodedSpans {
+		var sp basictracer.RawSpan
+		if err := DecodeRawSpan(enc, &sp); err != nil {
+			return nil, err
+		}
+		spans = append(spans, rawSpanToJaegerThrift(&sp))
+	}
+	return &jaegerthrift.Batch{
+		Process: &jaegerthrift.Process{ServiceName: "cockroach"},
+		Spans:   spans,
+	}, nil
+}
+
+func rawSpanToJaegerThrift(sp *basictracer.RawSpan) *jaegerthrift.Span {
+	var flags int32
+	if sp.Context.Sampled {
+		flags = 1
+	}
+	span := &jaegerthrift.Span{
+		TraceIdLow:    int64(sp.Context.TraceID),
+		SpanId:        int64(sp.Context.SpanID),
+		ParentSpanId:  int64(sp.ParentSpanID),
+		OperationName: sp.Operation,
+		Flags:         flags,
+		StartTime:     sp.Start.UnixNano() / 1e3,
+		Duration:      sp.Duration.Nanoseconds() / 1e3,
+	}
+	for k, v := range sp.Tags {
+		span.Tags = append(span.Tags, valueToJaegerTag(k, v))
+	}
+	for _, l := range sp.Logs {
+		span.Logs = append(span.Logs, logToJaegerThrift(l))
+	}
+	return span
+}
+
+func logToJaegerThrift(l basictracer.LogData) *jaegerthrift.Log {
+	log := &jaegerthrift.Log{Timestamp: l.Timestamp.UnixNano() / 1e3}
+	if l.Event != "" {
+		log.Fields = append(log.Fields, valueToJaegerTag("event", l.Event))
+	}
+	for _, f := range l.Fields {
+		p := fieldToProto(f)
+		log.Fields = append(log.Fields, fieldProtoToJaegerTag(p))
+	}
+	return log
+}
+
+// valueToJaegerTag renders an arbitrary tag value (from RawSpan.Tags, whose
+// values can be anything SetTag accepted) as a Jaeger Thrift Tag.
+func valueToJaegerTag(key string, value interface{}) *jaegerthrift.Tag {
+	tag := &jaegerthrift.Tag{Key: key}
+	switch v := value.(type) {
+	case string:
+		tag.VType, tag.VStr = jaegerthrift.TagType_STRING, &v
+	case bool:
+		tag.VType, tag.VBool = jaegerthrift.TagType_BOOL, &v
+	case int64:
+		tag.VType, tag.VLong = jaegerthrift.TagType_LONG, &v
+	case float64:
+		tag.VType, tag.VDouble = jaegerthrift.TagType_DOUBLE, &v
+	default:
+		s := toString(value)
+		tag.VType, tag.VStr = jaegerthrift.TagType_STRING, &s
+	}
+	return tag
+}
+
+// fieldProtoToJaegerTag renders a decoded structured log.Field (via its
+// FieldProto wire representation) as a Jaeger Thrift Tag, preserving its
+// original type rather than stringifying it.
+func fieldProtoToJaegerTag(p *FieldProto) *jaegerthrift.Tag {
+	tag := &jaegerthrift.Tag{Key: p.Key}
+	switch p.Type {
+	case FieldType_FIELD_TYPE_INT64:
+		v := p.Int64Value
+		tag.VType, tag.VLong = jaegerthrift.TagType_LONG, &v
+	case FieldType_FIELD_TYPE_FLOAT64:
+		v := p.Float64Value
+		tag.VType, tag.VDouble = jaegerthrift.TagType_DOUBLE, &v
+	case FieldType_FIELD_TYPE_BOOL:
+		v := p.BoolValue
+		tag.VType, tag.VBool = jaegerthrift.TagType_BOOL, &v
+	default:
+		v := p.StringValue
+		tag.VType, tag.VStr = jaegerthrift.TagType_STRING, &v
+	}
+	return tag
+}
@@ -0,0 +1,105 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+//
+// Author: Andrei Matei (andrei@cockroachlabs.com)
+
+package tracing
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	basictracer "github.com/opentracing/basictracer-go"
+	otlog "github.com/opentracing/opentracing-go/log"
+)
+
+func testEncodedSpan(t *testing.T) []byte {
+	sp := basictracer.RawSpan{
+		Context: basictracer.SpanContext{
+			TraceID: 1,
+			SpanID:  2,
+		},
+		ParentSpanID: 3,
+		Operation:    "test-op",
+		Start:        time.Unix(1000, 0).UTC(),
+		Duration:     42 * time.Millisecond,
+		Tags:         map[string]interface{}{"k": "v", "n": 7},
+		Logs: []basictracer.LogData{
+			{
+				Timestamp: time.Unix(1000, 0).UTC(),
+				Fields:    []otlog.Field{otlog.Int64("count", 9)},
+			},
+		},
+	}
+	enc, err := EncodeRawSpan(&sp, nil)
+	if err != nil {
+		t.Fatalf("EncodeRawSpan: %s", err)
+	}
+	return enc
+}
+
+func TestDecodedSpansToZipkinJSON(t *testing.T) {
+	out, err := DecodedSpansToZipkinJSON([][]byte{testEncodedSpan(t)})
+	if err != nil {
+		t.Fatalf("DecodedSpansToZipkinJSON: %s", err)
+	}
+
+	var spans []zipkinV2Span
+	if err := json.Unmarshal(out, &spans); err != nil {
+		t.Fatalf("unmarshaling output: %s", err)
+	}
+	if len(spans) != 1 {
+		t.Fatalf("got %d spans, expected 1", len(spans))
+	}
+	z := spans[0]
+	if z.TraceID != formatZipkinID(1) || z.ID != formatZipkinID(2) || z.ParentID != formatZipkinID(3) {
+		t.Fatalf("unexpected IDs: %+v", z)
+	}
+	if z.Name != "test-op" {
+		t.Fatalf("got name %q, expected test-op", z.Name)
+	}
+	if z.Tags["k"] != "v" {
+		t.Fatalf("got tags %+v, expected k=v", z.Tags)
+	}
+	if len(z.Annotations) != 1 {
+		t.Fatalf("got %d annotations, expected 1", len(z.Annotations))
+	}
+}
+
+func TestDecodedSpansToJaegerBatch(t *testing.T) {
+	batch, err := DecodedSpansToJaegerBatch([][]byte{testEncodedSpan(t)})
+	if err != nil {
+		t.Fatalf("DecodedSpansToJaegerBatch: %s", err)
+	}
+	if batch.Process.ServiceName != "cockroach" {
+		t.Fatalf("got service name %q, expected cockroach", batch.Process.ServiceName)
+	}
+	if len(batch.Spans) != 1 {
+		t.Fatalf("got %d spans, expected 1", len(batch.Spans))
+	}
+	sp := batch.Spans[0]
+	if sp.TraceIdLow != 1 || sp.SpanId != 2 || sp.ParentSpanId != 3 {
+		t.Fatalf("unexpected IDs: %+v", sp)
+	}
+	if sp.OperationName != "test-op" {
+		t.Fatalf("got operation name %q, expected test-op", sp.OperationName)
+	}
+	if len(sp.Tags) != 2 {
+		t.Fatalf("got %d tags, expected 2", len(sp.Tags))
+	}
+	if len(sp.Logs) != 1 || len(sp.Logs[0].Fields) != 1 {
+		t.Fatalf("got logs %+v, expected one log with one field", sp.Logs)
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+//
+// Author: Andrei Matei (andrei@cockroachlabs.com)
+
+package tracing
+
+import (
+	"fmt"
+
+	"golang.org/x/net/context"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	otlog "github.com/opentracing/opentracing-go/log"
+)
+
+// LogKV logs a list of alternating key/value pairs on the span found on
+// ctx, if any, as typed fields rather than a single stringified event. This
+// lets existing log.Infof-style callsites be mirrored onto spans with real
+// types, instead of callers having to know basictracer's raw log format.
+// It is a no-op if ctx carries no span.
+func LogKV(ctx context.Context, alternatingKeyValues ...interface{}) {
+	sp := opentracing.SpanFromContext(ctx)
+	if sp == nil {
+		return
+	}
+	sp.LogKV(alternatingKeyValues...)
+}
+
+// LogFields logs the given typed fields on the span found on ctx, if any.
+// It is a no-op if ctx carries no span.
+func LogFields(ctx context.Context, fields ...otlog.Field) {
+	sp := opentracing.SpanFromContext(ctx)
+	if sp == nil {
+		return
+	}
+	sp.LogFields(fields...)
+}
+
+// fieldEncoder implements otlog.Encoder, capturing the single value it's
+// given into a FieldProto so that typed fields survive EncodeRawSpan /
+// DecodeRawSpan and reach Jaeger/Zipkin/Lightstep as first-class structured
+// logs rather than stringified event names.
+type fieldEncoder struct {
+	out *FieldProto
+}
+
+func (e *fieldEncoder) EmitString(key, value string) {
+	e.out.Key, e.out.Type, e.out.StringValue = key, FieldType_FIELD_TYPE_STRING, value
+}
+
+func (e *fieldEncoder) EmitBool(key string, value bool) {
+	e.out.Key, e.out.Type, e.out.BoolValue = key, FieldType_FIELD_TYPE_BOOL, value
+}
+
+func (e *fieldEncoder) EmitInt(key string, value int) { e.EmitInt64(key, int64(value)) }
+
+func (e *fieldEncoder) EmitInt32(key string, value int32) { e.EmitInt64(key, int64(value)) }
+
+func (e *fieldEncoder) EmitInt64(key string, value int64) {
+	e.out.Key, e.out.Type, e.out.Int64Value = key, FieldType_FIELD_TYPE_INT64, value
+}
+
+func (e *fieldEncoder) EmitUint32(key string, value uint32) { e.EmitInt64(key, int64(value)) }
+
+func (e *fieldEncoder) EmitUint64(key string, value uint64) { e.EmitInt64(key, int64(value)) }
+
+func (e *fieldEncoder) EmitFloat32(key string, value float32) { e.EmitFloat64(key, float64(value)) }
+
+func (e *fieldEncoder) EmitFloat64(key string, value float64) {
+	e.out.Key, e.out.Type, e.out.Float64Value = key, FieldType_FIELD_TYPE_FLOAT64, value
+}
+
+func (e *fieldEncoder) EmitObject(key string, value interface{}) {
+	if err, ok := value.(error); ok {
+		e.out.Key, e.out.Type, e.out.StringValue = key, FieldType_FIELD_TYPE_ERROR, err.Error()
+		return
+	}
+	e.out.Key, e.out.Type, e.out.StringValue = key, FieldType_FIELD_TYPE_STRING, fmt.Sprint(value)
+}
+
+func (e *fieldEncoder) EmitLazyLogger(value otlog.LazyLogger) {
+	value(e)
+}
+
+// fieldToProto converts a single log.Field (as produced by LogKV/LogFields,
+// e.g. log.String, log.Int64, log.Error, ...) to its wire representation.
+func fieldToProto(f otlog.Field) *FieldProto {
+	p := &FieldProto{}
+	f.Marshal(&fieldEncoder{out: p})
+	return p
+}
+
+// protoToField is the inverse of fieldToProto. FIELD_TYPE_ERROR fields are
+// restored as strings, since the original error value itself doesn't
+// survive encoding -- only its message does.
+func protoToField(p *FieldProto) otlog.Field {
+	switch p.Type {
+	case FieldType_FIELD_TYPE_INT64:
+		return otlog.Int64(p.Key, p.Int64Value)
+	case FieldType_FIELD_TYPE_FLOAT64:
+		return otlog.Float64(p.Key, p.Float64Value)
+	case FieldType_FIELD_TYPE_BOOL:
+		return otlog.Bool(p.Key, p.BoolValue)
+	default:
+		return otlog.String(p.Key, p.StringValue)
+	}
+}
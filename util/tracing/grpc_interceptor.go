@@ -0,0 +1,252 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+//
+// Author: Andrei Matei (andrei@cockroachlabs.com)
+
+package tracing
+
+import (
+	"strings"
+
+	"golang.org/x/net/context"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// grpcSpanKindServer and grpcSpanKindClient are the span.kind tag values
+// used for RPC spans, per the OpenTracing semantic conventions.
+const (
+	grpcSpanKindServer = "server"
+	grpcSpanKindClient = "client"
+)
+
+// mdTextMap adapts a grpc metadata.MD to the opentracing.TextMapReader and
+// opentracing.TextMapWriter interfaces, so that span contexts can be
+// extracted from and injected into gRPC metadata with a tracer's ordinary
+// HTTPHeaders format.
+type mdTextMap metadata.MD
+
+// ForeachKey implements opentracing.TextMapReader.
+func (m mdTextMap) ForeachKey(handler func(key, val string) error) error {
+	for k, vs := range m {
+		for _, v := range vs {
+			if err := handler(k, v); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Set implements opentracing.TextMapWriter.
+func (m mdTextMap) Set(key, val string) {
+	key = strings.ToLower(key)
+	m[key] = append(m[key], val)
+}
+
+// tracerOrGlobal returns the tracer attached to ctx (via WithTracer), or
+// falls back to a newly minted global tracer if none was attached. This
+// lets the interceptors work even for callers that never threaded a tracer
+// through the context explicitly.
+func tracerOrGlobal(ctx context.Context) opentracing.Tracer {
+	if tr := TracerFromCtx(ctx); tr != nil {
+		return tr
+	}
+	return NewTracer()
+}
+
+// spanFromInboundContext extracts a span context carried in md (if any),
+// starts a server-side child span for method, and propagates the Snowball
+// baggage item so that trace-forcing crosses node boundaries transparently.
+func spanFromInboundContext(
+	ctx context.Context, md metadata.MD, method string,
+) opentracing.Span {
+	tr := tracerOrGlobal(ctx)
+	var opts []opentracing.StartSpanOption
+	if md != nil {
+		if wireContext, err := tr.Extract(opentracing.HTTPHeaders, mdTextMap(md)); err == nil {
+			opts = append(opts, opentracing.FollowsFrom(wireContext))
+		}
+	}
+	opts = append(opts, opentracing.Tag{Key: string(ext.SpanKind), Value: grpcSpanKindServer})
+	sp := tr.StartSpan(method, opts...)
+	baggage := make(map[string]string)
+	sp.Context().ForeachBaggageItem(func(k, v string) bool {
+		baggage[k] = v
+		sp.SetTag(k, v)
+		return true
+	})
+	forceSamplingFromBaggage(sp, baggage)
+	if p, ok := peer.FromContext(ctx); ok {
+		ext.PeerAddress.Set(sp, p.Addr.String())
+	}
+	return sp
+}
+
+// ServerInterceptor returns a grpc.UnaryServerInterceptor that extracts the
+// inbound span context (if any) from the request's gRPC metadata, starts a
+// child span named after the RPC method, and makes it available to the
+// handler via opentracing.ContextWithSpan. This frees RPC handlers from
+// having to call EnsureContext/JoinOrNew themselves.
+//
+// The tracer used is the one stored on the incoming context via WithTracer,
+// falling back to a global tracer if none was attached -- see
+// tracerOrGlobal -- so this doesn't require a tracer to be fixed at
+// interceptor-registration time.
+func ServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		sp := spanFromInboundContext(ctx, md, info.FullMethod)
+		defer sp.Finish()
+
+		ctx = opentracing.ContextWithSpan(ctx, sp)
+		resp, err := handler(ctx, req)
+		if err != nil {
+			ext.Error.Set(sp, true)
+			sp.SetTag("grpc.code", grpc.Code(err).String())
+			sp.LogEvent(err.Error())
+		}
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor is the streaming counterpart of ServerInterceptor.
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(
+		srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler,
+	) error {
+		ctx := ss.Context()
+		md, _ := metadata.FromIncomingContext(ctx)
+		sp := spanFromInboundContext(ctx, md, info.FullMethod)
+		defer sp.Finish()
+
+		err := handler(srv, &tracedServerStream{ServerStream: ss, ctx: opentracing.ContextWithSpan(ctx, sp)})
+		if err != nil {
+			ext.Error.Set(sp, true)
+			sp.SetTag("grpc.code", grpc.Code(err).String())
+			sp.LogEvent(err.Error())
+		}
+		return err
+	}
+}
+
+// tracedServerStream wraps a grpc.ServerStream to override its Context,
+// since grpc.ServerStream does not expose a way to swap the context that
+// was established before the interceptor ran.
+type tracedServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *tracedServerStream) Context() context.Context {
+	return s.ctx
+}
+
+// ClientInterceptor returns a grpc.UnaryClientInterceptor that starts a
+// client-side span named after the RPC method (as a child of any span
+// already on ctx) and injects its wire context into the outbound gRPC
+// metadata, so the callee's ServerInterceptor can pick up the trace.
+//
+// The tracer used is resolved per call via tracerOrGlobal (the tracer
+// stored on ctx via WithTracer, falling back to a global tracer).
+func ClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(
+		ctx context.Context,
+		method string,
+		req, reply interface{},
+		cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker,
+		opts ...grpc.CallOption,
+	) error {
+		tr := tracerOrGlobal(ctx)
+		var startOpts []opentracing.StartSpanOption
+		if parent := opentracing.SpanFromContext(ctx); parent != nil {
+			startOpts = append(startOpts, opentracing.ChildOf(parent.Context()))
+		}
+		startOpts = append(startOpts, opentracing.Tag{Key: string(ext.SpanKind), Value: grpcSpanKindClient})
+		sp := tr.StartSpan(method, startOpts...)
+		defer sp.Finish()
+
+		md, ok := metadata.FromOutgoingContext(ctx)
+		if !ok {
+			md = metadata.MD{}
+		} else {
+			md = md.Copy()
+		}
+		if err := tr.Inject(sp.Context(), opentracing.HTTPHeaders, mdTextMap(md)); err != nil {
+			sp.LogEvent(err.Error())
+		}
+		ctx = metadata.NewOutgoingContext(ctx, md)
+
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		if err != nil {
+			ext.Error.Set(sp, true)
+			sp.SetTag("grpc.code", grpc.Code(err).String())
+			sp.LogEvent(err.Error())
+		}
+		return err
+	}
+}
+
+// StreamClientInterceptor is the streaming counterpart of ClientInterceptor.
+// The span covers stream setup only (matching how grpc-go's own streaming
+// interceptors work); it is finished once Streamer returns. Like
+// ClientInterceptor, the tracer is resolved per call via tracerOrGlobal.
+func StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(
+		ctx context.Context,
+		desc *grpc.StreamDesc,
+		cc *grpc.ClientConn,
+		method string,
+		streamer grpc.Streamer,
+		opts ...grpc.CallOption,
+	) (grpc.ClientStream, error) {
+		tr := tracerOrGlobal(ctx)
+		var startOpts []opentracing.StartSpanOption
+		if parent := opentracing.SpanFromContext(ctx); parent != nil {
+			startOpts = append(startOpts, opentracing.ChildOf(parent.Context()))
+		}
+		startOpts = append(startOpts, opentracing.Tag{Key: string(ext.SpanKind), Value: grpcSpanKindClient})
+		sp := tr.StartSpan(method, startOpts...)
+		defer sp.Finish()
+
+		md, ok := metadata.FromOutgoingContext(ctx)
+		if !ok {
+			md = metadata.MD{}
+		} else {
+			md = md.Copy()
+		}
+		if err := tr.Inject(sp.Context(), opentracing.HTTPHeaders, mdTextMap(md)); err != nil {
+			sp.LogEvent(err.Error())
+		}
+		ctx = metadata.NewOutgoingContext(ctx, md)
+
+		cs, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			ext.Error.Set(sp, true)
+			sp.SetTag("grpc.code", grpc.Code(err).String())
+			sp.LogEvent(err.Error())
+		}
+		return cs, err
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+//
+// Author: Andrei Matei (andrei@cockroachlabs.com)
+
+package tracing
+
+import (
+	"errors"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	basictracer "github.com/opentracing/basictracer-go"
+	opentracing "github.com/opentracing/opentracing-go"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// TestServerInterceptorForcesSamplingFromBaggage verifies that
+// ServerInterceptor resolves the tracer from the incoming context and
+// force-samples the server-side span when the caller's wire context carried
+// a forced Snowball baggage item, matching JoinOrNew's behavior.
+func TestServerInterceptorForcesSamplingFromBaggage(t *testing.T) {
+	var recorded []basictracer.RawSpan
+	opts := defaultOptions(func(sp basictracer.RawSpan) {
+		recorded = append(recorded, sp)
+	})
+	// Keep baggage on the unsampled caller span; a trimming tracer drops it.
+	opts.TrimUnsampledSpans = false
+	tr := basictracer.NewWithOptions(opts)
+
+	caller := tr.StartSpan("caller")
+	caller.SetBaggageItem(Snowball, "1")
+	md := metadata.MD{}
+	if err := tr.Inject(caller.Context(), opentracing.HTTPHeaders, mdTextMap(md)); err != nil {
+		t.Fatalf("Inject: %s", err)
+	}
+	caller.Finish()
+
+	ctx := WithTracer(context.Background(), tr)
+	ctx = metadata.NewIncomingContext(ctx, md)
+
+	interceptor := ServerInterceptor()
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "resp", nil
+	}
+	resp, err := interceptor(ctx, "req", &grpc.UnaryServerInfo{FullMethod: "/Service/Method"}, handler)
+	if err != nil {
+		t.Fatalf("interceptor: %s", err)
+	}
+	if resp != "resp" {
+		t.Fatalf("got response %v, expected %q", resp, "resp")
+	}
+
+	if len(recorded) != 2 {
+		t.Fatalf("got %d recorded spans, expected 2 (caller + server)", len(recorded))
+	}
+	serverSpan := recorded[len(recorded)-1]
+	if !serverSpan.Context.Sampled {
+		t.Fatalf("expected the server span to be force-sampled via inbound Snowball baggage")
+	}
+}
+
+// TestServerInterceptorTagsErrors verifies that a handler error is tagged
+// on the span and still propagated to the caller.
+func TestServerInterceptorTagsErrors(t *testing.T) {
+	var recorded []basictracer.RawSpan
+	opts := defaultOptions(func(sp basictracer.RawSpan) {
+		recorded = append(recorded, sp)
+	})
+	// Keep tags on the unsampled server span; a trimming tracer drops them.
+	opts.TrimUnsampledSpans = false
+	tr := basictracer.NewWithOptions(opts)
+	ctx := WithTracer(context.Background(), tr)
+
+	wantErr := errors.New("boom")
+	interceptor := ServerInterceptor()
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, wantErr
+	}
+	_, err := interceptor(ctx, "req", &grpc.UnaryServerInfo{FullMethod: "/Service/Method"}, handler)
+	if err != wantErr {
+		t.Fatalf("got error %v, expected %v", err, wantErr)
+	}
+	if len(recorded) != 1 {
+		t.Fatalf("got %d recorded spans, expected 1", len(recorded))
+	}
+	if v, ok := recorded[0].Tags["error"]; !ok || v != true {
+		t.Fatalf("expected the span to be tagged with error=true, got %+v", recorded[0].Tags)
+	}
+}
+
+// TestClientInterceptorInjectsWireContext verifies that ClientInterceptor
+// starts a span and injects its wire context into the outgoing metadata for
+// the peer's ServerInterceptor to pick up.
+func TestClientInterceptorInjectsWireContext(t *testing.T) {
+	var recorded []basictracer.RawSpan
+	tr := basictracer.NewWithOptions(defaultOptions(func(sp basictracer.RawSpan) {
+		recorded = append(recorded, sp)
+	}))
+	ctx := WithTracer(context.Background(), tr)
+
+	var gotMD metadata.MD
+	invoker := func(
+		ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption,
+	) error {
+		gotMD, _ = metadata.FromOutgoingContext(ctx)
+		return nil
+	}
+
+	interceptor := ClientInterceptor()
+	if err := interceptor(ctx, "/Service/Method", "req", "reply", nil, invoker); err != nil {
+		t.Fatalf("interceptor: %s", err)
+	}
+
+	if len(recorded) != 1 {
+		t.Fatalf("got %d recorded spans, expected 1", len(recorded))
+	}
+	if len(gotMD) == 0 {
+		t.Fatalf("expected ClientInterceptor to inject a wire context into the outgoing metadata")
+	}
+}
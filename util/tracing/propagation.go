@@ -0,0 +1,110 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+//
+// Author: Andrei Matei (andrei@cockroachlabs.com)
+
+package tracing
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	basictracer "github.com/opentracing/basictracer-go"
+	opentracing "github.com/opentracing/opentracing-go"
+)
+
+// B3 header names, as defined by the Zipkin/Jaeger propagation format. See
+// https://github.com/openzipkin/b3-propagation.
+const (
+	b3TraceIDHeader      = "X-B3-Traceid"
+	b3SpanIDHeader       = "X-B3-Spanid"
+	b3ParentSpanIDHeader = "X-B3-Parentspanid"
+	b3SampledHeader      = "X-B3-Sampled"
+	b3FlagsHeader        = "X-B3-Flags"
+)
+
+// ExtractB3 parses the B3 propagation headers (as emitted by Zipkin- or
+// Jaeger-instrumented clients outside of CockroachDB) out of header and
+// returns the corresponding wire span context. It returns
+// opentracing.ErrSpanContextNotFound if header carries no B3 trace.
+func ExtractB3(header http.Header) (basictracer.SpanContext, error) {
+	traceIDStr := header.Get(b3TraceIDHeader)
+	spanIDStr := header.Get(b3SpanIDHeader)
+	if traceIDStr == "" || spanIDStr == "" {
+		return basictracer.SpanContext{}, opentracing.ErrSpanContextNotFound
+	}
+	traceID, err := strconv.ParseUint(traceIDStr, 16, 64)
+	if err != nil {
+		return basictracer.SpanContext{}, fmt.Errorf("tracing: invalid %s header: %s", b3TraceIDHeader, err)
+	}
+	spanID, err := strconv.ParseUint(spanIDStr, 16, 64)
+	if err != nil {
+		return basictracer.SpanContext{}, fmt.Errorf("tracing: invalid %s header: %s", b3SpanIDHeader, err)
+	}
+
+	sampled := header.Get(b3SampledHeader) == "1" || header.Get(b3FlagsHeader) == "1"
+
+	baggage := make(map[string]string)
+	if header.Get(b3FlagsHeader) == "1" {
+		// The "debug" flag forces sampling the same way our own Snowball
+		// baggage item does.
+		baggage[Snowball] = "1"
+	}
+
+	return basictracer.SpanContext{
+		TraceID: traceID,
+		SpanID:  spanID,
+		Sampled: sampled,
+		Baggage: baggage,
+	}, nil
+}
+
+// InjectB3 writes sp's wire context onto header using the B3 propagation
+// format, so that a downstream service speaking Zipkin's or Jaeger's native
+// propagation (rather than CockroachDB's DelegatingCarrier) can continue the
+// trace.
+func InjectB3(sp opentracing.Span, header http.Header) {
+	sc, ok := sp.Context().(basictracer.SpanContext)
+	if !ok {
+		return
+	}
+	header.Set(b3TraceIDHeader, strconv.FormatUint(sc.TraceID, 16))
+	header.Set(b3SpanIDHeader, strconv.FormatUint(sc.SpanID, 16))
+	if sc.Sampled {
+		header.Set(b3SampledHeader, "1")
+	} else {
+		header.Set(b3SampledHeader, "0")
+	}
+}
+
+// JoinOrNewFromB3 is the HTTP/gRPC-gateway counterpart of JoinOrNew: it
+// extracts a B3 trace context (as produced by Zipkin- or
+// Jaeger-instrumented clients that are not themselves CockroachDB nodes)
+// from header and starts opName as a child of it. If header carries no B3
+// trace, a new root span is started instead.
+func JoinOrNewFromB3(tr opentracing.Tracer, header http.Header, opName string) (opentracing.Span, error) {
+	wireContext, err := ExtractB3(header)
+	switch err {
+	case nil:
+		sp := tr.StartSpan(opName, opentracing.FollowsFrom(wireContext))
+		sp.Context().ForeachBaggageItem(func(k, v string) bool { sp.SetTag(k, v); return true })
+		sp.LogEvent(opName)
+		return sp, nil
+	case opentracing.ErrSpanContextNotFound:
+		return tr.StartSpan(opName), nil
+	default:
+		return nil, err
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+//
+// Author: Andrei Matei (andrei@cockroachlabs.com)
+
+package tracing
+
+import (
+	"net/http"
+	"testing"
+
+	basictracer "github.com/opentracing/basictracer-go"
+	opentracing "github.com/opentracing/opentracing-go"
+)
+
+func TestExtractB3(t *testing.T) {
+	t.Run("missing header", func(t *testing.T) {
+		if _, err := ExtractB3(http.Header{}); err != opentracing.ErrSpanContextNotFound {
+			t.Fatalf("got err %v, expected ErrSpanContextNotFound", err)
+		}
+	})
+
+	t.Run("invalid trace ID", func(t *testing.T) {
+		h := http.Header{}
+		h.Set(b3TraceIDHeader, "not-hex")
+		h.Set(b3SpanIDHeader, "2")
+		if _, err := ExtractB3(h); err == nil {
+			t.Fatalf("expected an error for a non-hex trace ID")
+		}
+	})
+
+	t.Run("sampled via X-B3-Sampled", func(t *testing.T) {
+		h := http.Header{}
+		h.Set(b3TraceIDHeader, "1")
+		h.Set(b3SpanIDHeader, "2")
+		h.Set(b3SampledHeader, "1")
+		sc, err := ExtractB3(h)
+		if err != nil {
+			t.Fatalf("ExtractB3: %s", err)
+		}
+		if sc.TraceID != 1 || sc.SpanID != 2 || !sc.Sampled {
+			t.Fatalf("got %+v, expected TraceID=1 SpanID=2 Sampled=true", sc)
+		}
+		if sc.Baggage[Snowball] != "" {
+			t.Fatalf("expected no forced Snowball baggage without the debug flag")
+		}
+	})
+
+	t.Run("debug flag forces Snowball baggage", func(t *testing.T) {
+		h := http.Header{}
+		h.Set(b3TraceIDHeader, "1")
+		h.Set(b3SpanIDHeader, "2")
+		h.Set(b3FlagsHeader, "1")
+		sc, err := ExtractB3(h)
+		if err != nil {
+			t.Fatalf("ExtractB3: %s", err)
+		}
+		if !sc.Sampled {
+			t.Fatalf("expected the debug flag to imply sampling")
+		}
+		if sc.Baggage[Snowball] != "1" {
+			t.Fatalf("expected the debug flag to force Snowball baggage")
+		}
+	})
+}
+
+func TestInjectB3(t *testing.T) {
+	tr := basictracer.NewWithOptions(defaultOptions(func(_ basictracer.RawSpan) {}))
+	sp := tr.StartSpan("op")
+	sc := sp.Context().(basictracer.SpanContext)
+	sc.Sampled = true
+
+	h := http.Header{}
+	InjectB3(sp, h)
+	if got := h.Get(b3TraceIDHeader); got == "" {
+		t.Fatalf("expected %s to be set", b3TraceIDHeader)
+	}
+	if got := h.Get(b3SpanIDHeader); got == "" {
+		t.Fatalf("expected %s to be set", b3SpanIDHeader)
+	}
+}
+
+func TestJoinOrNewFromB3(t *testing.T) {
+	tr := basictracer.NewWithOptions(defaultOptions(func(_ basictracer.RawSpan) {}))
+
+	t.Run("no header starts a root span", func(t *testing.T) {
+		sp, err := JoinOrNewFromB3(tr, http.Header{}, "op")
+		if err != nil {
+			t.Fatalf("JoinOrNewFromB3: %s", err)
+		}
+		sp.Finish()
+	})
+
+	t.Run("valid header joins the wire context", func(t *testing.T) {
+		h := http.Header{}
+		h.Set(b3TraceIDHeader, "a")
+		h.Set(b3SpanIDHeader, "b")
+		sp, err := JoinOrNewFromB3(tr, h, "op")
+		if err != nil {
+			t.Fatalf("JoinOrNewFromB3: %s", err)
+		}
+		sc := sp.Context().(basictracer.SpanContext)
+		if sc.TraceID != 0xa {
+			t.Fatalf("got trace ID %x, expected 0xa", sc.TraceID)
+		}
+		sp.Finish()
+	})
+}
@@ -0,0 +1,235 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+//
+// Author: Andrei Matei (andrei@cockroachlabs.com)
+
+package tracing
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/cockroach/settings"
+)
+
+// SamplingPriorityBaggageKey is the baggage item consulted (in addition to
+// our own Snowball item) to let a request force-sample a trace, mirroring
+// the OpenTracing sampling.priority tag for the case where only baggage --
+// not tags -- survives propagation across a node boundary.
+const SamplingPriorityBaggageKey = "sampling.priority"
+
+var sampleRateSetting = settings.RegisterFloatSetting(
+	"trace.sample_rate",
+	"probability (0-1) with which a new trace is sampled, absent a "+
+		"per-operation override or forced sampling",
+	0,
+)
+
+var maxTracesPerSecondSetting = settings.RegisterFloatSetting(
+	"trace.max_traces_per_second",
+	"maximum number of newly sampled traces started per second, across all "+
+		"operations, to protect the configured trace collector(s) from overload",
+	500,
+)
+
+var perOperationSampleRatesSetting = settings.RegisterStringSetting(
+	"trace.sample_rate.per_operation",
+	"JSON object mapping operation name to sample rate (0-1), overriding "+
+		"trace.sample_rate for that operation",
+	"{}",
+)
+
+// Sampler centralizes the sampling decisions that defaultOptions hardcodes
+// to "never" (relying entirely on ad-hoc Snowball tagging for anything of
+// interest); newTracer replaces that hook with Sampler.Allow. It combines a global probabilistic rate, optional
+// per-operation overrides, and a token-bucket limit on newly sampled traces
+// per second to protect the configured collector(s) from overload.
+type Sampler struct {
+	mu struct {
+		sync.Mutex
+		rate  float64
+		perOp map[string]float64
+	}
+	limiter *tokenBucket
+}
+
+// NewSampler creates a Sampler with the given default (global) sample rate
+// and a token-bucket limit of maxTracesPerSecond newly sampled traces per
+// second.
+func NewSampler(rate float64, maxTracesPerSecond float64) *Sampler {
+	s := &Sampler{limiter: newTokenBucket(maxTracesPerSecond)}
+	s.mu.rate = rate
+	return s
+}
+
+// SamplerFromSettings builds a Sampler from the current values of the
+// trace.sample_rate, trace.max_traces_per_second and
+// trace.sample_rate.per_operation cluster settings. Callers that want the
+// Sampler to track later setting changes should register an OnChange
+// callback (via the relevant settings.*Setting) that calls SetRate /
+// SetPerOperationRates on the result.
+func SamplerFromSettings() *Sampler {
+	s := NewSampler(sampleRateSetting.Get(), maxTracesPerSecondSetting.Get())
+	s.SetPerOperationRates(parsePerOperationRates(perOperationSampleRatesSetting.Get()))
+	return s
+}
+
+func parsePerOperationRates(raw string) map[string]float64 {
+	var rates map[string]float64
+	if err := json.Unmarshal([]byte(raw), &rates); err != nil {
+		return nil
+	}
+	return rates
+}
+
+// SetRate updates the default (global) sample rate used for operations
+// without a per-operation override.
+func (s *Sampler) SetRate(rate float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.mu.rate = rate
+}
+
+// SetMaxTracesPerSecond updates the token-bucket rate limit.
+func (s *Sampler) SetMaxTracesPerSecond(maxTracesPerSecond float64) {
+	s.limiter.setRate(maxTracesPerSecond)
+}
+
+// SetPerOperationRates installs per-operation-name sample rate overrides.
+func (s *Sampler) SetPerOperationRates(rates map[string]float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.mu.perOp = rates
+}
+
+// rateFor returns the configured sample rate for opName, falling back to
+// the global rate when there is no override.
+func (s *Sampler) rateFor(opName string) float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r, ok := s.mu.perOp[opName]; ok {
+		return r
+	}
+	return s.mu.rate
+}
+
+// Allow applies only the global rate and the rate limiter to traceID. It
+// does not know the operation name, so it cannot apply per-operation
+// overrides or honor forced sampling; it is meant for wiring into
+// third-party tracers (basictracer, zipkin-go-opentracing) whose sampling
+// hook is keyed by trace ID alone.
+func (s *Sampler) Allow(traceID uint64) bool {
+	s.mu.Lock()
+	rate := s.mu.rate
+	s.mu.Unlock()
+	return s.decide(rate, traceID) && s.limiter.allow()
+}
+
+// ShouldSample decides whether a new root span for opName should be
+// sampled, honoring (in order): an inbound request to force-sample --
+// either our own Snowball baggage item or an OpenTracing sampling.priority
+// baggage item set by an upstream non-CockroachDB service -- then any
+// per-operation override, then the global rate. A forced decision bypasses
+// the rate limiter, matching the convention that sampling.priority > 0
+// always wins.
+func (s *Sampler) ShouldSample(opName string, traceID uint64, baggage map[string]string) bool {
+	if baggage[Snowball] == "1" {
+		return true
+	}
+	if p, ok := baggage[SamplingPriorityBaggageKey]; ok && p != "" && p != "0" {
+		return true
+	}
+	return s.decide(s.rateFor(opName), traceID) && s.limiter.allow()
+}
+
+func (s *Sampler) decide(rate float64, traceID uint64) bool {
+	switch {
+	case rate <= 0:
+		return false
+	case rate >= 1:
+		return true
+	default:
+		// Derive a float in [0, 1) from traceID rather than calling rand
+		// directly, so that the decision for a given trace is stable across
+		// the tee'd tracers (basictracer, Jaeger, Zipkin) that
+		// each see the same trace ID.
+		return float64(traceID%1e6)/1e6 < rate
+	}
+}
+
+// tokenBucket is a small, self-contained token-bucket rate limiter. It
+// exists so Sampler doesn't have to take on an extra vendored dependency
+// for what is a handful of lines.
+type tokenBucket struct {
+	mu       sync.Mutex
+	rate     float64
+	capacity float64
+	tokens   float64
+	last     time.Time
+}
+
+func newTokenBucket(ratePerSecond float64) *tokenBucket {
+	return &tokenBucket{
+		rate:     ratePerSecond,
+		capacity: ratePerSecond,
+		tokens:   ratePerSecond,
+		last:     time.Now(),
+	}
+}
+
+func (b *tokenBucket) setRate(ratePerSecond float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rate = ratePerSecond
+	b.capacity = ratePerSecond
+}
+
+func (b *tokenBucket) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	b.last = now
+	if b.tokens > b.capacity {
+		b.tokens = b.capacity
+	}
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// globalSampler is the Sampler consulted by newTracer's tracers. It starts
+// out sampling nothing (preserving the previous hardcoded behavior) until
+// SetSampler is called, typically once during server startup with a
+// Sampler wired up to the cluster settings above.
+var globalSamplerMu sync.Mutex
+var globalSampler = NewSampler(0, 500)
+
+// SetSampler installs sampler as the Sampler consulted by future spans
+// started through NewTracer's tracers. It does not affect tracers already
+// created by a prior call to NewTracer.
+func SetSampler(sampler *Sampler) {
+	globalSamplerMu.Lock()
+	defer globalSamplerMu.Unlock()
+	globalSampler = sampler
+}
+
+func currentSampler() *Sampler {
+	globalSamplerMu.Lock()
+	defer globalSamplerMu.Unlock()
+	return globalSampler
+}
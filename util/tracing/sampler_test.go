@@ -0,0 +1,92 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+//
+// Author: Andrei Matei (andrei@cockroachlabs.com)
+
+package tracing
+
+import (
+	"sync"
+	"testing"
+)
+
+// TestSamplerShouldSampleForced verifies that an inbound Snowball or
+// sampling.priority baggage item always forces sampling, regardless of a
+// zero global rate.
+func TestSamplerShouldSampleForced(t *testing.T) {
+	s := NewSampler(0 /* rate */, 1000 /* maxTracesPerSecond */)
+
+	if s.ShouldSample("op", 1, nil) {
+		t.Fatalf("expected no sampling at rate 0 with no forcing baggage")
+	}
+	if !s.ShouldSample("op", 1, map[string]string{Snowball: "1"}) {
+		t.Fatalf("expected Snowball baggage to force sampling")
+	}
+	if !s.ShouldSample("op", 1, map[string]string{SamplingPriorityBaggageKey: "1"}) {
+		t.Fatalf("expected sampling.priority baggage to force sampling")
+	}
+	if s.ShouldSample("op", 1, map[string]string{SamplingPriorityBaggageKey: "0"}) {
+		t.Fatalf("sampling.priority=0 should not force sampling")
+	}
+}
+
+// TestSamplerPerOperationOverride verifies that a per-operation override
+// takes precedence over the global rate.
+func TestSamplerPerOperationOverride(t *testing.T) {
+	s := NewSampler(0 /* rate */, 1000 /* maxTracesPerSecond */)
+	s.SetPerOperationRates(map[string]float64{"hot-op": 1})
+
+	if s.ShouldSample("cold-op", 1, nil) {
+		t.Fatalf("expected cold-op to fall back to the global rate of 0")
+	}
+	if !s.ShouldSample("hot-op", 1, nil) {
+		t.Fatalf("expected hot-op's override rate of 1 to always sample")
+	}
+}
+
+// TestSamplerAllowConcurrentWithSetRate exercises Allow (the hook wired
+// into every basictracer/Zipkin span) concurrently with SetRate (as would
+// happen from a cluster-setting OnChange callback) under the race detector.
+func TestSamplerAllowConcurrentWithSetRate(t *testing.T) {
+	s := NewSampler(1 /* rate */, 1e6 /* maxTracesPerSecond */)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+		go func(traceID uint64) {
+			defer wg.Done()
+			s.Allow(traceID)
+		}(uint64(i))
+		go func() {
+			defer wg.Done()
+			s.SetRate(1)
+		}()
+	}
+	wg.Wait()
+}
+
+// TestTokenBucketLimitsRate verifies that the token bucket caps the number
+// of allowed traces within its initial burst.
+func TestTokenBucketLimitsRate(t *testing.T) {
+	b := newTokenBucket(5)
+	allowed := 0
+	for i := 0; i < 100; i++ {
+		if b.allow() {
+			allowed++
+		}
+	}
+	if allowed != 5 {
+		t.Fatalf("expected exactly 5 allowed (the initial burst), got %d", allowed)
+	}
+}
@@ -17,9 +17,6 @@
 package tracing
 
 import (
-	"bytes"
-	"encoding/gob"
-
 	"golang.org/x/net/context"
 
 	"github.com/cockroachdb/cockroach/util/caller"
@@ -43,7 +40,10 @@ func (cr CallbackRecorder) RecordSpan(sp basictracer.RawSpan) {
 }
 
 // JoinOrNew creates a new Span joined to the provided DelegatingCarrier or
-// creates Span from the given tracer.
+// creates Span from the given tracer. For spans arriving from outside
+// CockroachDB (e.g. over HTTP/gRPC from a Zipkin- or Jaeger-instrumented
+// service that doesn't speak our DelegatingCarrier wire format), see
+// JoinOrNewFromB3.
 func JoinOrNew(tr opentracing.Tracer, carrier *Span, opName string) (opentracing.Span, error) {
 	if carrier != nil {
 		wireContext, err := tr.Extract(basictracer.Delegator, carrier)
@@ -52,7 +52,13 @@ func JoinOrNew(tr opentracing.Tracer, carrier *Span, opName string) (opentracing
 			sp := tr.StartSpan(opName, opentracing.FollowsFrom(wireContext))
 
 			// Copy baggage items to tags so they show up in the Lightstep UI.
-			sp.Context().ForeachBaggageItem(func(k, v string) bool { sp.SetTag(k, v); return true })
+			baggage := make(map[string]string)
+			sp.Context().ForeachBaggageItem(func(k, v string) bool {
+				baggage[k] = v
+				sp.SetTag(k, v)
+				return true
+			})
+			forceSamplingFromBaggage(sp, baggage)
 
 			sp.LogEvent(opName)
 			return sp, nil
@@ -64,6 +70,20 @@ func JoinOrNew(tr opentracing.Tracer, carrier *Span, opName string) (opentracing
 	return tr.StartSpan(opName), nil
 }
 
+// forceSamplingFromBaggage checks baggage for an inbound request to
+// force-sample the trace -- either our own Snowball item or an OpenTracing
+// sampling.priority item set by an upstream non-CockroachDB service -- and,
+// if found, marks sp accordingly so the decision carries across further
+// node boundaries, even if our own Sampler would otherwise have dropped
+// this trace. Called by JoinOrNew and the gRPC server interceptor;
+// JoinOrNewFromB3 does not call it.
+func forceSamplingFromBaggage(sp opentracing.Span, baggage map[string]string) {
+	if p, ok := baggage[SamplingPriorityBaggageKey]; (ok && p != "" && p != "0") || baggage[Snowball] == "1" {
+		ext.SamplingPriority.Set(sp, 1)
+		sp.SetBaggageItem(Snowball, "1")
+	}
+}
+
 // JoinOrNewSnowball returns a Span which records directly via the specified
 // callback. If the given DelegatingCarrier is nil, a new Span is created.
 // otherwise, the created Span is a child.
@@ -102,6 +122,9 @@ func NewTracerAndSpanFor7881(
 // used in an async task that might outlive the original operation.
 //
 // Returns the new context and a function that closes the span.
+//
+// Most callers launching an async task should prefer RunAsync, which wraps
+// this to also launch the goroutine, recover panics, and report the result.
 func ForkCtxSpan(ctx context.Context, opName string) (context.Context, func()) {
 	if span := opentracing.SpanFromContext(ctx); span != nil {
 		if span.BaggageItem(Snowball) == "1" {
@@ -134,18 +157,37 @@ var lightstepToken = envutil.EnvOrDefaultString("COCKROACH_LIGHTSTEP_TOKEN", "")
 var lightstepOnly = envutil.EnvOrDefaultBool("COCKROACH_LIGHTSTEP_ONLY", false)
 
 // newTracer implements NewTracer and allows that function to be mocked out via Disable().
+//
+// Which collectors a tracer reports to is controlled by environment
+// variables, so that operators aren't locked into a single SaaS backend:
+// COCKROACH_LIGHTSTEP_TOKEN selects Lightstep, COCKROACH_JAEGER_AGENT
+// selects a local Jaeger agent (Thrift/UDP), and COCKROACH_ZIPKIN_URL
+// selects a Zipkin collector (HTTP). Any combination of these may be set at
+// once; every configured collector is composed into a TeeTracer, except
+// that with COCKROACH_LIGHTSTEP_ONLY set only the Lightstep tracer is used.
+//
+// KNOWN GAP: basicTr and the Jaeger/Zipkin collectors from extraTracers all
+// have sampler wired into their sampling hook, but lightstep-tracer-go's
+// NewTracer exposes no equivalent hook, so with COCKROACH_LIGHTSTEP_TOKEN
+// set every span is reported to Lightstep regardless of trace.sample_rate.
 var newTracer = func() opentracing.Tracer {
+	sampler := currentSampler()
+	basicOpts := defaultOptions(func(_ basictracer.RawSpan) {})
+	basicOpts.ShouldSample = sampler.Allow
+	basicTr := basictracer.NewWithOptions(basicOpts)
 	if lightstepToken != "" {
 		lsTr := lightstep.NewTracer(lightstep.Options{AccessToken: lightstepToken})
 		if lightstepOnly {
 			return lsTr
 		}
-		basicTr := basictracer.NewWithOptions(defaultOptions(func(_ basictracer.RawSpan) {}))
 		// The TeeTracer uses the first tracer for serialization of span contexts;
 		// lightspan needs to be first because it correlates spans between nodes.
-		return NewTeeTracer(lsTr, basicTr)
+		return NewTeeTracer(lsTr, append([]opentracing.Tracer{basicTr}, extraTracers()...)...)
 	}
-	return basictracer.NewWithOptions(defaultOptions(func(_ basictracer.RawSpan) {}))
+	if extra := extraTracers(); len(extra) > 0 {
+		return NewTeeTracer(basicTr, extra...)
+	}
+	return basicTr
 }
 
 // NewTracer creates a Tracer which records to the net/trace
@@ -179,20 +221,6 @@ func Disable() func() {
 	}
 }
 
-// EncodeRawSpan encodes a raw span into bytes, using the given dest slice
-// as a buffer.
-func EncodeRawSpan(rawSpan *basictracer.RawSpan, dest []byte) ([]byte, error) {
-	// This is not a greatly efficient (but convenient) use of gob.
-	buf := bytes.NewBuffer(dest[:0])
-	err := gob.NewEncoder(buf).Encode(rawSpan)
-	return buf.Bytes(), err
-}
-
-// DecodeRawSpan unmarshals into the given RawSpan.
-func DecodeRawSpan(enc []byte, dest *basictracer.RawSpan) error {
-	return gob.NewDecoder(bytes.NewBuffer(enc)).Decode(dest)
-}
-
 // contextTracerKeyType is an empty type for the handle associated with the
 // tracer value (see context.Value).
 type contextTracerKeyType struct{}
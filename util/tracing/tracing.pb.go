@@ -0,0 +1,70 @@
+// Hand-written to mirror util/tracing/tracing.proto; the repo's usual
+// protoc-gen-gogofaster invocation (which would emit Marshal/Unmarshal/Size
+// methods) hasn't been run over it, so it relies on gogo/protobuf's
+// reflection-based proto.Marshal/proto.Unmarshal instead. If tracing.proto
+// changes, update this file by hand to match, or run it through protoc and
+// replace this file (and this comment) with the real generated output.
+
+package tracing
+
+import proto "github.com/gogo/protobuf/proto"
+
+// FieldType enumerates the log.Field value kinds preserved across the wire.
+type FieldType int32
+
+const (
+	FieldType_FIELD_TYPE_STRING  FieldType = 0
+	FieldType_FIELD_TYPE_INT64   FieldType = 1
+	FieldType_FIELD_TYPE_FLOAT64 FieldType = 2
+	FieldType_FIELD_TYPE_BOOL    FieldType = 3
+	FieldType_FIELD_TYPE_ERROR   FieldType = 4
+)
+
+// FieldProto mirrors a single typed opentracing-go/log.Field.
+type FieldProto struct {
+	Key          string    `protobuf:"bytes,1,opt,name=key" json:"key"`
+	Type         FieldType `protobuf:"varint,2,opt,name=type,enum=cockroach.util.tracing.FieldType" json:"type"`
+	StringValue  string    `protobuf:"bytes,3,opt,name=string_value,json=stringValue" json:"string_value"`
+	Int64Value   int64     `protobuf:"varint,4,opt,name=int64_value,json=int64Value" json:"int64_value"`
+	Float64Value float64   `protobuf:"fixed64,5,opt,name=float64_value,json=float64Value" json:"float64_value"`
+	BoolValue    bool      `protobuf:"varint,6,opt,name=bool_value,json=boolValue" json:"bool_value"`
+}
+
+func (m *FieldProto) Reset()         { *m = FieldProto{} }
+func (m *FieldProto) String() string { return proto.CompactTextString(m) }
+func (*FieldProto) ProtoMessage()    {}
+
+// LogRecordProto mirrors a single basictracer.LogData entry.
+type LogRecordProto struct {
+	TimestampNanos int64         `protobuf:"varint,1,opt,name=timestamp_nanos,json=timestampNanos" json:"timestamp_nanos"`
+	Event          string        `protobuf:"bytes,2,opt,name=event" json:"event"`
+	Fields         []*FieldProto `protobuf:"bytes,3,rep,name=fields" json:"fields,omitempty"`
+}
+
+func (m *LogRecordProto) Reset()         { *m = LogRecordProto{} }
+func (m *LogRecordProto) String() string { return proto.CompactTextString(m) }
+func (*LogRecordProto) ProtoMessage()    {}
+
+// RawSpanProto mirrors basictracer.RawSpan. See tracing.proto.
+type RawSpanProto struct {
+	TraceID       uint64            `protobuf:"varint,1,opt,name=trace_id,json=traceId" json:"trace_id"`
+	SpanID        uint64            `protobuf:"varint,2,opt,name=span_id,json=spanId" json:"span_id"`
+	ParentSpanID  uint64            `protobuf:"varint,3,opt,name=parent_span_id,json=parentSpanId" json:"parent_span_id"`
+	Operation     string            `protobuf:"bytes,4,opt,name=operation" json:"operation"`
+	StartNanos    int64             `protobuf:"varint,5,opt,name=start_nanos,json=startNanos" json:"start_nanos"`
+	DurationNanos int64             `protobuf:"varint,6,opt,name=duration_nanos,json=durationNanos" json:"duration_nanos"`
+	Sampled       bool              `protobuf:"varint,7,opt,name=sampled" json:"sampled"`
+	Tags          map[string]string `protobuf:"bytes,8,rep,name=tags" json:"tags,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Logs          []*LogRecordProto `protobuf:"bytes,9,rep,name=logs" json:"logs,omitempty"`
+	Baggage       map[string]string `protobuf:"bytes,10,rep,name=baggage" json:"baggage,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+}
+
+func (m *RawSpanProto) Reset()         { *m = RawSpanProto{} }
+func (m *RawSpanProto) String() string { return proto.CompactTextString(m) }
+func (*RawSpanProto) ProtoMessage()    {}
+
+func init() {
+	proto.RegisterType((*FieldProto)(nil), "cockroach.util.tracing.FieldProto")
+	proto.RegisterType((*LogRecordProto)(nil), "cockroach.util.tracing.LogRecordProto")
+	proto.RegisterType((*RawSpanProto)(nil), "cockroach.util.tracing.RawSpanProto")
+}